@@ -0,0 +1,215 @@
+package sqlxml
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//region Batch insert
+
+// defaultMaxBatchRows is used when Options.MaxBatchRows is zero.
+const defaultMaxBatchRows = 1000
+
+// defaultMaxBatchParams is used when Options.MaxBatchParams is zero. 65535
+// is the Postgres/MySQL placeholder limit; callers targeting SQL Server
+// (limit 2100) should set Options.MaxBatchParams explicitly.
+const defaultMaxBatchParams = 65535
+
+// batchValuesRe locates a single-row "VALUES (...)" tuple at the end of a
+// rendered INSERT script, capturing the keyword (to preserve its casing)
+// and the tuple's contents so ExecMany can replicate it per row.
+var batchValuesRe = regexp.MustCompile(`(?i)(VALUES)\s*\(([^()]*)\)\s*$`)
+
+// batchPlaceholderRe matches the named bind placeholders inside a VALUES
+// tuple, the same ":name" syntax sqlx.PrepareNamedContext expects.
+var batchPlaceholderRe = regexp.MustCompile(`:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// batchInsertHeaderRe extracts the target table and column list from
+// "INSERT INTO table (col1, col2, ...)", used only to drive Options.PgCopyFunc.
+var batchInsertHeaderRe = regexp.MustCompile(`(?i)INSERT\s+INTO\s+([A-Za-z0-9_."]+)\s*\(([^()]*)\)`)
+
+// batchResult implements sql.Result over the chunks ExecMany executes:
+// RowsAffected sums every chunk's count, LastInsertId reports the last
+// chunk's (a single ID is meaningless across a multi-row insert on most
+// drivers, but some report the first or last row of the batch).
+type batchResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r batchResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r batchResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// ExecMany renders scriptName once to find its single-row
+// "INSERT INTO t(...) VALUES (:a, :b)" tuple, then executes all of args as
+// one or more multi-row INSERTs: "VALUES (:a_0,:b_0),(:a_1,:b_1),...".
+// Batches are chunked so no single statement exceeds Options.MaxBatchRows
+// rows or Options.MaxBatchParams bound parameters. If Options.PgCopyFunc is
+// set and the resolved pool's driver is "pgx", ExecMany uses it instead of
+// a multi-row INSERT.
+//
+// scriptName's SQL is assumed static across rows (no <if>/<choose> tags
+// that vary per row); only args[i] itself differs row to row.
+func (d *Database) ExecMany(ctx context.Context, scriptName string, args []any) (sql.Result, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(args) == 0 {
+		return batchResult{}, nil
+	}
+
+	script, ok := d.client.scripts()[scriptName]
+	if !ok {
+		return nil, ErrNoScript
+	}
+
+	sqlText, _, err := script.render(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	loc := batchValuesRe.FindStringSubmatchIndex(sqlText)
+	if loc == nil {
+		return nil, fmt.Errorf("sqlxml: script %q has no single-row VALUES(...) clause to batch", scriptName)
+	}
+	prefix := sqlText[:loc[0]] + sqlText[loc[2]:loc[3]] + " "
+	tuple := sqlText[loc[4]:loc[5]]
+	suffix := sqlText[loc[1]:]
+
+	placeholders := batchPlaceholderRe.FindAllStringSubmatch(tuple, -1)
+	if len(placeholders) == 0 {
+		return nil, fmt.Errorf("sqlxml: script %q's VALUES(...) clause has no bind placeholders", scriptName)
+	}
+
+	rowParams := make([]map[string]any, len(args))
+	for i, arg := range args {
+		params, err := argToParamMap(arg)
+		if err != nil {
+			return nil, err
+		}
+		rowParams[i] = params
+	}
+
+	pool, err := d.resolveDB(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.client.opt.PgCopyFunc != nil && pool.DriverName() == "pgx" {
+		if table, columns, ok := parseInsertHeader(sqlText); ok {
+			return d.execManyCopy(ctx, pool, table, columns, placeholders, rowParams)
+		}
+	}
+
+	maxRows := d.client.opt.MaxBatchRows
+	if maxRows <= 0 {
+		maxRows = defaultMaxBatchRows
+	}
+	maxParams := d.client.opt.MaxBatchParams
+	if maxParams <= 0 {
+		maxParams = defaultMaxBatchParams
+	}
+	if perRow := len(placeholders); perRow > 0 && maxParams/perRow < maxRows {
+		maxRows = maxParams / perRow
+	}
+	if maxRows < 1 {
+		maxRows = 1
+	}
+
+	var total batchResult
+	for start := 0; start < len(rowParams); start += maxRows {
+		end := start + maxRows
+		if end > len(rowParams) {
+			end = len(rowParams)
+		}
+
+		chunkSQL, chunkParams := buildBatchChunk(prefix, tuple, suffix, rowParams[start:end])
+
+		nStmt, err := pool.PrepareNamedContext(ctx, chunkSQL)
+		if err != nil {
+			return nil, err
+		}
+		res, err := nStmt.ExecContext(ctx, chunkParams)
+		_ = nStmt.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if affected, err := res.RowsAffected(); err == nil {
+			total.rowsAffected += affected
+		}
+		if id, err := res.LastInsertId(); err == nil {
+			total.lastInsertID = id
+		}
+	}
+
+	return total, nil
+}
+
+// buildBatchChunk replicates tuple once per row in rows, suffixing every
+// placeholder with the row's position in the chunk so they bind uniquely,
+// and returns the assembled SQL together with the expanded param map.
+func buildBatchChunk(prefix, tuple, suffix string, rows []map[string]any) (string, map[string]any) {
+	tuples := make([]string, len(rows))
+	params := make(map[string]any, len(rows)*4)
+
+	for i, row := range rows {
+		rendered := batchPlaceholderRe.ReplaceAllStringFunc(tuple, func(m string) string {
+			name := m[1:]
+			synth := fmt.Sprintf("%s_%d", name, i)
+			params[synth] = row[name]
+			return ":" + synth
+		})
+		tuples[i] = "(" + rendered + ")"
+	}
+
+	return prefix + strings.Join(tuples, ",") + suffix, params
+}
+
+// parseInsertHeader extracts the table name and column list from an
+// "INSERT INTO table (col1, col2, ...)" header, for Options.PgCopyFunc.
+func parseInsertHeader(sqlText string) (table string, columns []string, ok bool) {
+	m := batchInsertHeaderRe.FindStringSubmatch(sqlText)
+	if m == nil {
+		return "", nil, false
+	}
+
+	for _, col := range strings.Split(m[2], ",") {
+		columns = append(columns, strings.Trim(strings.TrimSpace(col), `"`))
+	}
+	return m[1], columns, true
+}
+
+// execManyCopy hands the batch to Options.PgCopyFunc instead of issuing a
+// multi-row INSERT, binding each row's values in the same order as the
+// placeholders captured from the VALUES(...) tuple.
+func (d *Database) execManyCopy(ctx context.Context, pool *sqlx.DB, table string, columns []string, placeholders [][]string, rowParams []map[string]any) (sql.Result, error) {
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	rows := make([][]any, len(rowParams))
+	for i, params := range rowParams {
+		row := make([]any, len(placeholders))
+		for j, ph := range placeholders {
+			row[j] = params[ph[1]]
+		}
+		rows[i] = row
+	}
+
+	n, err := d.client.opt.PgCopyFunc(ctx, conn, table, columns, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return batchResult{rowsAffected: n}, nil
+}
+
+//endregion
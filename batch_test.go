@@ -0,0 +1,166 @@
+package sqlxml
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestBuildBatchChunk(t *testing.T) {
+	rows := []map[string]any{
+		{"a": 1, "b": "x"},
+		{"a": 2, "b": "y"},
+	}
+
+	sqlText, params := buildBatchChunk("INSERT INTO t(a,b) VALUES ", ":a, :b", "", rows)
+
+	want := "INSERT INTO t(a,b) VALUES (:a_0, :b_0),(:a_1, :b_1)"
+	if sqlText != want {
+		t.Errorf("got %q, want %q", sqlText, want)
+	}
+
+	wantParams := map[string]any{"a_0": 1, "b_0": "x", "a_1": 2, "b_1": "y"}
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("got params %v, want %v", params, wantParams)
+	}
+}
+
+func TestParseInsertHeader(t *testing.T) {
+	table, columns, ok := parseInsertHeader(`INSERT INTO users (id, name, "email") VALUES (:id_0,:name_0,:email_0)`)
+	if !ok {
+		t.Fatal("expected parseInsertHeader to match")
+	}
+	if table != "users" {
+		t.Errorf("table = %q, want %q", table, "users")
+	}
+
+	sort.Strings(columns)
+	want := []string{"email", "id", "name"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %v, want %v", columns, want)
+	}
+}
+
+func TestParseInsertHeaderNoMatch(t *testing.T) {
+	if _, _, ok := parseInsertHeader("UPDATE users SET name = :name"); ok {
+		t.Error("expected parseInsertHeader to report no match for a non-INSERT statement")
+	}
+}
+
+func newMockDatabaseWithScript(t *testing.T, scriptName, content string, opt *Options) (*Database, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = mockDB.Close() })
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	entry := &databaseEntry{name: "default", primary: db}
+
+	compiled, err := compileScript(content)
+	if err != nil {
+		t.Fatalf("compileScript failed: %v", err)
+	}
+	scriptMap := map[string]*compiledScript{scriptName: compiled}
+
+	if opt == nil {
+		opt = &Options{}
+	}
+	client := &Client{
+		dbMap: map[string]*databaseEntry{"default": entry},
+		opt:   opt,
+	}
+	client.scriptMap.Store(&scriptMap)
+	client.stmtCaches = make(map[*sqlx.DB]*stmtCache)
+
+	return client.Database("default"), mock
+}
+
+func TestExecManyChunksByMaxBatchRows(t *testing.T) {
+	const script = `INSERT INTO users(name, age) VALUES (:name, :age)`
+
+	d, mock := newMockDatabaseWithScript(t, "insertUser", script, &Options{MaxBatchRows: 2})
+
+	mock.ExpectPrepare(`INSERT INTO users\(name, age\) VALUES \(\?, \?\),\(\?, \?\)`).
+		ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectPrepare(`INSERT INTO users\(name, age\) VALUES \(\?, \?\)$`).
+		ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	args := []any{
+		map[string]any{"name": "ann", "age": 30},
+		map[string]any{"name": "bob", "age": 31},
+		map[string]any{"name": "cid", "age": 32},
+	}
+
+	res, err := d.ExecMany(context.Background(), "insertUser", args)
+	if err != nil {
+		t.Fatalf("ExecMany failed: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("RowsAffected failed: %v", err)
+	}
+	if affected != 3 {
+		t.Errorf("RowsAffected = %d, want 3", affected)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestExecManyChunksByMaxBatchParams(t *testing.T) {
+	const script = `INSERT INTO users(name, age) VALUES (:name, :age)`
+
+	// 2 placeholders per row, param limit of 5 -> at most 2 rows per chunk
+	// even though MaxBatchRows alone would allow more.
+	d, mock := newMockDatabaseWithScript(t, "insertUser", script, &Options{MaxBatchRows: 100, MaxBatchParams: 5})
+
+	mock.ExpectPrepare(`VALUES \(\?, \?\),\(\?, \?\)`).
+		ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectPrepare(`VALUES \(\?, \?\)$`).
+		ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	args := []any{
+		map[string]any{"name": "ann", "age": 30},
+		map[string]any{"name": "bob", "age": 31},
+		map[string]any{"name": "cid", "age": 32},
+	}
+
+	if _, err := d.ExecMany(context.Background(), "insertUser", args); err != nil {
+		t.Fatalf("ExecMany failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestExecManyNoRows(t *testing.T) {
+	const script = `INSERT INTO users(name) VALUES (:name)`
+	d, _ := newMockDatabaseWithScript(t, "insertUser", script, nil)
+
+	res, err := d.ExecMany(context.Background(), "insertUser", nil)
+	if err != nil {
+		t.Fatalf("ExecMany failed: %v", err)
+	}
+	if affected, _ := res.RowsAffected(); affected != 0 {
+		t.Errorf("RowsAffected = %d, want 0", affected)
+	}
+}
+
+func TestExecManyRejectsScriptWithoutValuesClause(t *testing.T) {
+	const script = `SELECT * FROM users WHERE id = :id`
+	d, _ := newMockDatabaseWithScript(t, "selectUser", script, nil)
+
+	if _, err := d.ExecMany(context.Background(), "selectUser", []any{map[string]any{"id": 1}}); err == nil {
+		t.Error("expected an error for a script with no VALUES(...) clause")
+	}
+}
@@ -0,0 +1,578 @@
+package sqlxml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+//region Dynamic SQL nodes
+
+// dynamicNode is one piece of a parsed script: either literal SQL text or a
+// MyBatis-style dynamic tag (<if>, <where>, <set>, <trim>, <choose>,
+// <foreach>). render evaluates the node against params and returns the SQL
+// text it contributes.
+type dynamicNode interface {
+	render(p *dynamicParams) (string, error)
+}
+
+type containerNode struct {
+	children []dynamicNode
+}
+
+func (n *containerNode) render(p *dynamicParams) (string, error) {
+	var sb strings.Builder
+	for _, child := range n.children {
+		s, err := child.render(p)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s)
+	}
+	return sb.String(), nil
+}
+
+type textNode struct {
+	text string
+}
+
+func (n *textNode) render(_ *dynamicParams) (string, error) {
+	return n.text, nil
+}
+
+type ifNode struct {
+	test string
+	body *containerNode
+}
+
+func (n *ifNode) render(p *dynamicParams) (string, error) {
+	ok, err := evalExpr(n.test, p)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", nil
+	}
+	return n.body.render(p)
+}
+
+type whereNode struct {
+	body *containerNode
+}
+
+func (n *whereNode) render(p *dynamicParams) (string, error) {
+	body, err := n.body.render(p)
+	if err != nil {
+		return "", err
+	}
+	return applyTrim(body, "WHERE", "", []string{"AND", "OR"}, nil), nil
+}
+
+type setNode struct {
+	body *containerNode
+}
+
+func (n *setNode) render(p *dynamicParams) (string, error) {
+	body, err := n.body.render(p)
+	if err != nil {
+		return "", err
+	}
+	return applyTrim(body, "SET", "", nil, []string{","}), nil
+}
+
+type trimNode struct {
+	prefix          string
+	suffix          string
+	prefixOverrides []string
+	suffixOverrides []string
+	body            *containerNode
+}
+
+func (n *trimNode) render(p *dynamicParams) (string, error) {
+	body, err := n.body.render(p)
+	if err != nil {
+		return "", err
+	}
+	return applyTrim(body, n.prefix, n.suffix, n.prefixOverrides, n.suffixOverrides), nil
+}
+
+type whenNode struct {
+	test string
+	body *containerNode
+}
+
+type chooseNode struct {
+	whens     []*whenNode
+	otherwise *containerNode
+}
+
+func (n *chooseNode) render(p *dynamicParams) (string, error) {
+	for _, w := range n.whens {
+		ok, err := evalExpr(w.test, p)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return w.body.render(p)
+		}
+	}
+	if n.otherwise != nil {
+		return n.otherwise.render(p)
+	}
+	return "", nil
+}
+
+type foreachNode struct {
+	collection string
+	item       string
+	index      string
+	separator  string
+	open       string
+	close      string
+	body       *containerNode
+}
+
+var foreachPlaceholderRe = regexp.MustCompile(`:([A-Za-z_][A-Za-z0-9_.]*)`)
+
+func (n *foreachNode) render(p *dynamicParams) (string, error) {
+	coll, err := p.resolve(n.collection)
+	if err != nil {
+		return "", err
+	}
+
+	rv := reflect.ValueOf(coll)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return "", fmt.Errorf("sqlxml: foreach collection %q is not a slice or array", n.collection)
+	}
+
+	parts := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		child := p.pushScope(n.item, rv.Index(i).Interface(), n.index, i)
+
+		raw, err := n.body.render(child)
+		if err != nil {
+			return "", err
+		}
+
+		var rewriteErr error
+		rendered := foreachPlaceholderRe.ReplaceAllStringFunc(raw, func(m string) string {
+			name := m[1:]
+			root := name
+			if dot := strings.IndexByte(name, '.'); dot >= 0 {
+				root = name[:dot]
+			}
+			if root != n.item && root != n.index {
+				return m
+			}
+
+			val, err := child.resolve(name)
+			if err != nil {
+				rewriteErr = err
+				return m
+			}
+
+			synth := fmt.Sprintf("__%s_%d", strings.ReplaceAll(name, ".", "_"), i)
+			p.params[synth] = val
+			return ":" + synth
+		})
+		if rewriteErr != nil {
+			return "", rewriteErr
+		}
+
+		parts = append(parts, rendered)
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+
+	return n.open + strings.Join(parts, n.separator) + n.close, nil
+}
+
+func applyTrim(s, prefix, suffix string, prefixOverrides, suffixOverrides []string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+
+	for _, ov := range prefixOverrides {
+		if hasPrefixFold(s, ov) {
+			s = strings.TrimSpace(s[len(ov):])
+			break
+		}
+	}
+	for _, ov := range suffixOverrides {
+		if hasSuffixFold(s, ov) {
+			s = strings.TrimSpace(s[:len(s)-len(ov)])
+			break
+		}
+	}
+
+	if s == "" {
+		return ""
+	}
+	if prefix != "" {
+		s = prefix + " " + s
+	}
+	if suffix != "" {
+		s = s + " " + suffix
+	}
+	return s
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func hasSuffixFold(s, suffix string) bool {
+	return len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix)
+}
+
+//endregion
+
+//region Parsing
+
+// parseScriptNodes parses a script's raw inner XML (as captured by
+// scriptXml's `innerxml` field) into a tree of dynamicNodes. Scripts with no
+// dynamic tags parse into a single containerNode holding one textNode, so
+// the render path is identical either way.
+func parseScriptNodes(content string) (*containerNode, error) {
+	const rootName = "__sqlxml_root__"
+	dec := xml.NewDecoder(strings.NewReader("<" + rootName + ">" + content + "</" + rootName + ">"))
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return parseNodeChildren(dec, rootName)
+}
+
+func parseNodeChildren(dec *xml.Decoder, closeName string) (*containerNode, error) {
+	container := &containerNode{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			container.children = append(container.children, &textNode{text: string(t)})
+		case xml.StartElement:
+			node, err := parseElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			container.children = append(container.children, node)
+		case xml.EndElement:
+			if t.Name.Local == closeName {
+				return container, nil
+			}
+			return nil, fmt.Errorf("sqlxml: unexpected closing tag </%s>", t.Name.Local)
+		}
+	}
+}
+
+func parseElement(dec *xml.Decoder, start xml.StartElement) (dynamicNode, error) {
+	name := start.Name.Local
+	switch name {
+	case "if":
+		body, err := parseNodeChildren(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		return &ifNode{test: xmlAttr(start, "test"), body: body}, nil
+	case "where":
+		body, err := parseNodeChildren(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		return &whereNode{body: body}, nil
+	case "set":
+		body, err := parseNodeChildren(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		return &setNode{body: body}, nil
+	case "trim":
+		body, err := parseNodeChildren(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		return &trimNode{
+			prefix:          xmlAttr(start, "prefix"),
+			suffix:          xmlAttr(start, "suffix"),
+			prefixOverrides: splitOverrides(xmlAttr(start, "prefixOverrides")),
+			suffixOverrides: splitOverrides(xmlAttr(start, "suffixOverrides")),
+			body:            body,
+		}, nil
+	case "foreach":
+		body, err := parseNodeChildren(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		return &foreachNode{
+			collection: xmlAttr(start, "collection"),
+			item:       xmlAttr(start, "item"),
+			index:      xmlAttr(start, "index"),
+			separator:  xmlAttr(start, "separator"),
+			open:       xmlAttr(start, "open"),
+			close:      xmlAttr(start, "close"),
+			body:       body,
+		}, nil
+	case "choose":
+		return parseChoose(dec)
+	default:
+		return nil, fmt.Errorf("sqlxml: unknown dynamic tag <%s>", name)
+	}
+}
+
+func parseChoose(dec *xml.Decoder) (dynamicNode, error) {
+	node := &chooseNode{}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "when":
+				body, err := parseNodeChildren(dec, "when")
+				if err != nil {
+					return nil, err
+				}
+				node.whens = append(node.whens, &whenNode{test: xmlAttr(t, "test"), body: body})
+			case "otherwise":
+				body, err := parseNodeChildren(dec, "otherwise")
+				if err != nil {
+					return nil, err
+				}
+				node.otherwise = body
+			default:
+				return nil, fmt.Errorf("sqlxml: <choose> only accepts <when>/<otherwise>, got <%s>", t.Name.Local)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "choose" {
+				return node, nil
+			}
+		}
+	}
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func splitOverrides(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+//endregion
+
+//region Compiled script
+
+// compiledScript is a script XML body parsed once at load time. Rendering
+// it against an arg is pure string assembly plus a param map copy. source
+// keeps the original XML content so a reload can detect whether a script
+// actually changed.
+type compiledScript struct {
+	source string
+	root   *containerNode
+}
+
+func compileScript(content string) (*compiledScript, error) {
+	root, err := parseScriptNodes(content)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledScript{source: content, root: root}, nil
+}
+
+// render evaluates the script's dynamic tags against arg (a struct or
+// map[string]any) and returns the final SQL text together with the
+// expanded parameter map to bind it with.
+func (s *compiledScript) render(arg any) (string, map[string]any, error) {
+	params, err := argToParamMap(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &dynamicParams{arg: arg, params: params}
+	sqlText, err := s.root.render(p)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return normalizeWhitespace(sqlText), p.params, nil
+}
+
+var whitespaceRe = regexp.MustCompile(`\s+`)
+
+func normalizeWhitespace(s string) string {
+	return strings.TrimSpace(whitespaceRe.ReplaceAllString(s, " "))
+}
+
+//endregion
+
+//region Param resolution
+
+// dynamicParams resolves identifiers used in tag tests and foreach bodies.
+// scope holds loop variables bound by an enclosing foreach; anything not
+// found there falls back to the call's arg. params accumulates the final
+// bound-parameter map and is shared by every node in the tree.
+type dynamicParams struct {
+	arg    any
+	scope  map[string]any
+	parent *dynamicParams
+	params map[string]any
+}
+
+func (p *dynamicParams) pushScope(item string, itemVal any, index string, indexVal int) *dynamicParams {
+	scope := make(map[string]any, 2)
+	if item != "" {
+		scope[item] = itemVal
+	}
+	if index != "" {
+		scope[index] = indexVal
+	}
+	return &dynamicParams{arg: p.arg, parent: p, scope: scope, params: p.params}
+}
+
+func (p *dynamicParams) resolve(path string) (any, error) {
+	root := path
+	rest := ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		root = path[:i]
+		rest = path[i+1:]
+	}
+
+	for s := p; s != nil; s = s.parent {
+		if v, ok := s.scope[root]; ok {
+			return resolveFieldPath(v, rest)
+		}
+	}
+
+	return resolveFieldPath(p.arg, path)
+}
+
+// resolveFieldPath walks a dotted path over a struct or map via reflect.
+// A missing field or nil intermediate value resolves to nil rather than an
+// error, so "if" tests on optional fields behave like a falsy check.
+func resolveFieldPath(v any, path string) (any, error) {
+	if path == "" {
+		return v, nil
+	}
+
+	cur := v
+	for _, seg := range strings.Split(path, ".") {
+		if cur == nil {
+			return nil, nil
+		}
+
+		rv := reflect.ValueOf(cur)
+		for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			rv = rv.Elem()
+		}
+
+		switch rv.Kind() {
+		case reflect.Map:
+			mv := rv.MapIndex(reflect.ValueOf(seg))
+			if !mv.IsValid() {
+				return nil, nil
+			}
+			cur = mv.Interface()
+		case reflect.Struct:
+			fv := fieldByNameFold(rv, seg)
+			if !fv.IsValid() {
+				return nil, nil
+			}
+			cur = fv.Interface()
+		default:
+			return nil, nil
+		}
+	}
+
+	return cur, nil
+}
+
+func fieldByNameFold(rv reflect.Value, name string) reflect.Value {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Tag.Get("db") == name || strings.EqualFold(f.Name, name) {
+			return rv.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// argToParamMap flattens arg into the map[string]any that PrepareNamedContext
+// binds against. Struct fields are keyed the same way sqlx keys them: the
+// `db` tag if present, otherwise the lower-cased field name.
+func argToParamMap(arg any) (map[string]any, error) {
+	if arg == nil {
+		return map[string]any{}, nil
+	}
+
+	if m, ok := arg.(map[string]any); ok {
+		out := make(map[string]any, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		return out, nil
+	}
+
+	rv := reflect.ValueOf(arg)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlxml: arg must be a struct or map[string]any, got %T", arg)
+	}
+
+	out := make(map[string]any)
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out[name] = rv.Field(i).Interface()
+	}
+
+	return out, nil
+}
+
+//endregion
@@ -0,0 +1,134 @@
+package sqlxml
+
+import (
+	"fmt"
+	"testing"
+)
+
+func renderScript(t *testing.T, content string, arg any) string {
+	t.Helper()
+
+	script, err := compileScript(content)
+	if err != nil {
+		t.Fatalf("compileScript failed: %v", err)
+	}
+
+	sqlText, _, err := script.render(arg)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	return sqlText
+}
+
+func TestRenderIfTag(t *testing.T) {
+	content := `SELECT * FROM users <if test="name != nil">WHERE name = :name</if>`
+
+	got := renderScript(t, content, map[string]any{"name": "ann"})
+	want := `SELECT * FROM users WHERE name = :name`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = renderScript(t, content, map[string]any{})
+	want = `SELECT * FROM users`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderWhereTag(t *testing.T) {
+	content := `SELECT * FROM users
+		<where>
+			<if test="name != nil">AND name = :name</if>
+			<if test="age != nil">AND age = :age</if>
+		</where>`
+
+	got := renderScript(t, content, map[string]any{"age": 30})
+	want := `SELECT * FROM users WHERE age = :age`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = renderScript(t, content, map[string]any{})
+	want = `SELECT * FROM users`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderSetTag(t *testing.T) {
+	content := `UPDATE users
+		<set>
+			<if test="name != nil">name = :name,</if>
+			<if test="age != nil">age = :age,</if>
+		</set>
+		WHERE id = :id`
+
+	got := renderScript(t, content, map[string]any{"name": "ann"})
+	want := `UPDATE users SET name = :name WHERE id = :id`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderChooseTag(t *testing.T) {
+	content := `SELECT * FROM users WHERE
+		<choose>
+			<when test="id != nil">id = :id</when>
+			<when test="name != nil">name = :name</when>
+			<otherwise>1 = 1</otherwise>
+		</choose>`
+
+	got := renderScript(t, content, map[string]any{"name": "ann"})
+	want := `SELECT * FROM users WHERE name = :name`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = renderScript(t, content, map[string]any{})
+	want = `SELECT * FROM users WHERE 1 = 1`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderForeachTag(t *testing.T) {
+	content := `SELECT * FROM users WHERE id IN
+		<foreach collection="ids" item="id" open="(" separator="," close=")">:id</foreach>`
+
+	script, err := compileScript(content)
+	if err != nil {
+		t.Fatalf("compileScript failed: %v", err)
+	}
+
+	sqlText, params, err := script.render(map[string]any{"ids": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	want := `SELECT * FROM users WHERE id IN (:__id_0,:__id_1,:__id_2)`
+	if sqlText != want {
+		t.Errorf("got %q, want %q", sqlText, want)
+	}
+
+	for i, expected := range []int{1, 2, 3} {
+		key := fmt.Sprintf("__id_%d", i)
+		v, ok := params[key]
+		if !ok {
+			t.Fatalf("params missing key %q: %v", key, params)
+		}
+		if v != expected {
+			t.Errorf("params[%q] = %v, want %v", key, v, expected)
+		}
+	}
+}
+
+func TestRenderForeachEmptyCollection(t *testing.T) {
+	content := `SELECT * FROM users <if test="ids">WHERE id IN <foreach collection="ids" item="id" open="(" separator="," close=")">:id</foreach></if>`
+
+	got := renderScript(t, content, map[string]any{"ids": []int{}})
+	want := `SELECT * FROM users`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
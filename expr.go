@@ -0,0 +1,419 @@
+package sqlxml
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode"
+)
+
+//region Expression evaluator
+
+// evalExpr evaluates the small boolean/comparison language used by <if> and
+// <when> test attributes: ==, !=, <, >, <=, >=, &&, ||, !, string/number
+// literals and dotted property access resolved through p.
+func evalExpr(src string, p *dynamicParams) (bool, error) {
+	parser := &exprParser{lex: newExprLexer(src), p: p}
+	if err := parser.advance(); err != nil {
+		return false, err
+	}
+
+	v, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.tok.kind != exprTokEOF {
+		return false, fmt.Errorf("sqlxml: unexpected trailing tokens in expression %q", src)
+	}
+
+	return toBool(v), nil
+}
+
+type exprTokenKind int
+
+const (
+	exprTokEOF exprTokenKind = iota
+	exprTokIdent
+	exprTokNumber
+	exprTokString
+	exprTokAnd
+	exprTokOr
+	exprTokNot
+	exprTokEq
+	exprTokNeq
+	exprTokLt
+	exprTokLte
+	exprTokGt
+	exprTokGte
+	exprTokLParen
+	exprTokRParen
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+type exprLexer struct {
+	src []rune
+	pos int
+}
+
+func newExprLexer(s string) *exprLexer {
+	return &exprLexer{src: []rune(s)}
+}
+
+func (l *exprLexer) peek() rune {
+	if l.pos >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos]
+}
+
+func (l *exprLexer) next() (exprToken, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return exprToken{kind: exprTokEOF}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return exprToken{kind: exprTokLParen}, nil
+	case c == ')':
+		l.pos++
+		return exprToken{kind: exprTokRParen}, nil
+	case c == '!':
+		l.pos++
+		if l.peek() == '=' {
+			l.pos++
+			return exprToken{kind: exprTokNeq}, nil
+		}
+		return exprToken{kind: exprTokNot}, nil
+	case c == '=':
+		l.pos++
+		if l.peek() == '=' {
+			l.pos++
+		}
+		return exprToken{kind: exprTokEq}, nil
+	case c == '<':
+		l.pos++
+		if l.peek() == '=' {
+			l.pos++
+			return exprToken{kind: exprTokLte}, nil
+		}
+		return exprToken{kind: exprTokLt}, nil
+	case c == '>':
+		l.pos++
+		if l.peek() == '=' {
+			l.pos++
+			return exprToken{kind: exprTokGte}, nil
+		}
+		return exprToken{kind: exprTokGt}, nil
+	case c == '&' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '&':
+		l.pos += 2
+		return exprToken{kind: exprTokAnd}, nil
+	case c == '|' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '|':
+		l.pos += 2
+		return exprToken{kind: exprTokOr}, nil
+	case c == '\'' || c == '"':
+		return l.lexString(c)
+	case unicode.IsDigit(c):
+		return l.lexNumber()
+	case unicode.IsLetter(c) || c == '_':
+		return l.lexIdent()
+	default:
+		return exprToken{}, fmt.Errorf("sqlxml: unexpected character %q in expression", c)
+	}
+}
+
+func (l *exprLexer) lexString(quote rune) (exprToken, error) {
+	l.pos++
+	start := l.pos
+	for l.pos < len(l.src) && l.src[l.pos] != quote {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return exprToken{}, fmt.Errorf("sqlxml: unterminated string literal in expression")
+	}
+	text := string(l.src[start:l.pos])
+	l.pos++
+	return exprToken{kind: exprTokString, text: text}, nil
+}
+
+func (l *exprLexer) lexNumber() (exprToken, error) {
+	start := l.pos
+	for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+		l.pos++
+	}
+	return exprToken{kind: exprTokNumber, text: string(l.src[start:l.pos])}, nil
+}
+
+func (l *exprLexer) lexIdent() (exprToken, error) {
+	start := l.pos
+	for l.pos < len(l.src) && (unicode.IsLetter(l.src[l.pos]) || unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '_' || l.src[l.pos] == '.') {
+		l.pos++
+	}
+	text := string(l.src[start:l.pos])
+	switch text {
+	case "and":
+		return exprToken{kind: exprTokAnd}, nil
+	case "or":
+		return exprToken{kind: exprTokOr}, nil
+	case "not":
+		return exprToken{kind: exprTokNot}, nil
+	default:
+		return exprToken{kind: exprTokIdent, text: text}, nil
+	}
+}
+
+type exprParser struct {
+	lex *exprLexer
+	tok exprToken
+	p   *dynamicParams
+}
+
+func (pr *exprParser) advance() error {
+	tok, err := pr.lex.next()
+	if err != nil {
+		return err
+	}
+	pr.tok = tok
+	return nil
+}
+
+func (pr *exprParser) parseOr() (any, error) {
+	left, err := pr.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for pr.tok.kind == exprTokOr {
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		right, err := pr.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = toBool(left) || toBool(right)
+	}
+	return left, nil
+}
+
+func (pr *exprParser) parseAnd() (any, error) {
+	left, err := pr.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for pr.tok.kind == exprTokAnd {
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		right, err := pr.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = toBool(left) && toBool(right)
+	}
+	return left, nil
+}
+
+func (pr *exprParser) parseUnary() (any, error) {
+	if pr.tok.kind == exprTokNot {
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		v, err := pr.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return !toBool(v), nil
+	}
+	return pr.parseComparison()
+}
+
+func (pr *exprParser) parseComparison() (any, error) {
+	left, err := pr.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch pr.tok.kind {
+	case exprTokEq, exprTokNeq, exprTokLt, exprTokLte, exprTokGt, exprTokGte:
+		op := pr.tok.kind
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		right, err := pr.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return compareValues(op, left, right)
+	default:
+		return left, nil
+	}
+}
+
+func (pr *exprParser) parsePrimary() (any, error) {
+	switch pr.tok.kind {
+	case exprTokLParen:
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		v, err := pr.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if pr.tok.kind != exprTokRParen {
+			return nil, fmt.Errorf("sqlxml: expected ')' in expression")
+		}
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case exprTokString:
+		v := pr.tok.text
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case exprTokNumber:
+		v, err := strconv.ParseFloat(pr.tok.text, 64)
+		if err != nil {
+			return nil, err
+		}
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case exprTokIdent:
+		name := pr.tok.text
+		if err := pr.advance(); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil", "null":
+			return nil, nil
+		}
+		return pr.p.resolve(name)
+	default:
+		return nil, fmt.Errorf("sqlxml: unexpected token in expression")
+	}
+}
+
+func compareValues(op exprTokenKind, left, right any) (any, error) {
+	if lf, rf, ok := asFloats(left, right); ok {
+		switch op {
+		case exprTokEq:
+			return lf == rf, nil
+		case exprTokNeq:
+			return lf != rf, nil
+		case exprTokLt:
+			return lf < rf, nil
+		case exprTokLte:
+			return lf <= rf, nil
+		case exprTokGt:
+			return lf > rf, nil
+		case exprTokGte:
+			return lf >= rf, nil
+		}
+	}
+
+	ls, rs := toStr(left), toStr(right)
+	switch op {
+	case exprTokEq:
+		return ls == rs, nil
+	case exprTokNeq:
+		return ls != rs, nil
+	case exprTokLt:
+		return ls < rs, nil
+	case exprTokLte:
+		return ls <= rs, nil
+	case exprTokGt:
+		return ls > rs, nil
+	case exprTokGte:
+		return ls >= rs, nil
+	}
+	return nil, fmt.Errorf("sqlxml: unsupported comparison operator")
+}
+
+func asFloats(a, b any) (float64, float64, bool) {
+	af, aok := asFloat(a)
+	bf, bok := asFloat(b)
+	return af, bf, aok && bok
+}
+
+func asFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(rv.String(), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	default:
+		return 0, false
+	}
+}
+
+func toStr(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func toBool(v any) bool {
+	if v == nil {
+		return false
+	}
+
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b != ""
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Ptr, reflect.Interface:
+		return !rv.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	default:
+		return true
+	}
+}
+
+//endregion
@@ -0,0 +1,68 @@
+package sqlxml
+
+import "testing"
+
+func TestEvalExpr(t *testing.T) {
+	params := &dynamicParams{
+		arg: map[string]any{
+			"age":    30,
+			"name":   "ann",
+			"active": true,
+			"tags":   []string{"a", "b"},
+			"empty":  []string{},
+		},
+		params: map[string]any{},
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"age == 30", true},
+		{"age != 30", false},
+		{"age > 18", true},
+		{"age >= 30", true},
+		{"age < 18", false},
+		{"age <= 29", false},
+		{"name == 'ann'", true},
+		{"name == \"bob\"", false},
+		{"active", true},
+		{"!active", false},
+		{"active && age > 18", true},
+		{"active && age > 100", false},
+		{"active || age > 100", true},
+		{"missing", false},
+		{"missing == nil", true},
+		{"tags", true},
+		{"empty", false},
+		{"(age > 18) && (name == 'ann')", true},
+		{"not active", false},
+	}
+
+	for _, c := range cases {
+		got, err := evalExpr(c.expr, params)
+		if err != nil {
+			t.Errorf("evalExpr(%q) returned error: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("evalExpr(%q) = %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	params := &dynamicParams{arg: map[string]any{}, params: map[string]any{}}
+
+	cases := []string{
+		"age ==",
+		"(age > 18",
+		"age @ 1",
+	}
+
+	for _, expr := range cases {
+		if _, err := evalExpr(expr, params); err == nil {
+			t.Errorf("evalExpr(%q) expected an error, got nil", expr)
+		}
+	}
+}
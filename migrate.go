@@ -0,0 +1,314 @@
+package sqlxml
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"time"
+)
+
+//region XML
+
+type migrationsXml struct {
+	XMLName    xml.Name       `xml:"migrations"`
+	Migrations []migrationXml `xml:"migration"`
+}
+
+type migrationXml struct {
+	XMLName xml.Name         `xml:"migration"`
+	Version string           `xml:"version,attr"`
+	Name    string           `xml:"name,attr"`
+	Up      migrationStepXml `xml:"up"`
+	Down    migrationStepXml `xml:"down"`
+}
+
+type migrationStepXml struct {
+	Transactional *bool  `xml:"transactional,attr"`
+	Content       string `xml:",chardata"`
+}
+
+func (s migrationStepXml) isTransactional() bool {
+	if s.Transactional == nil {
+		return true
+	}
+	return *s.Transactional
+}
+
+//endregion
+
+//region Migration
+
+// Migration is one XML-defined schema change, parsed once at load time.
+// Checksum covers the up/down SQL so Migrate can detect a migration file
+// edited after it was already applied; MigrationStatus does not compare it.
+type Migration struct {
+	Version           string
+	Name              string
+	Checksum          string
+	Up                string
+	UpTransactional   bool
+	Down              string
+	DownTransactional bool
+}
+
+// MigrationInfo reports a migration's current state against a database.
+type MigrationInfo struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+func loadMigrationsGlobFiles(opt *Options) ([]*Migration, error) {
+	var migrations []*Migration
+	seen := make(map[string]struct{})
+
+	paths, err := globFiles(opt, opt.MigrationsGlobFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		content, err := readFile(opt, path)
+		if err != nil {
+			return nil, err
+		}
+
+		data := new(migrationsXml)
+		if err := xml.Unmarshal(content, data); err != nil {
+			return nil, err
+		}
+
+		for _, m := range data.Migrations {
+			if _, ok := seen[m.Version]; ok {
+				return nil, fmt.Errorf("the migration version(%s) is duplicate", m.Version)
+			}
+			seen[m.Version] = struct{}{}
+
+			migrations = append(migrations, &Migration{
+				Version:           m.Version,
+				Name:              m.Name,
+				Checksum:          migrationChecksum(m.Up.Content, m.Down.Content),
+				Up:                m.Up.Content,
+				UpTransactional:   m.Up.isTransactional(),
+				Down:              m.Down.Content,
+				DownTransactional: m.Down.isTransactional(),
+			})
+		}
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func migrationChecksum(up, down string) string {
+	sum := sha256.Sum256([]byte(up + "\x00" + down))
+	return hex.EncodeToString(sum[:])
+}
+
+//endregion
+
+//region Database migration API
+
+// Migrate applies every pending migration in version order, up to and
+// including target (or all of them if target is empty). Each transactional
+// migration (the default) runs in its own transaction together with the
+// schema_migrations bookkeeping row; <up transactional="false"> runs
+// directly against the connection for statements a driver refuses to run
+// in a tx, such as Postgres's CREATE INDEX CONCURRENTLY.
+func (d *Database) Migrate(ctx context.Context, target string) error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.entry.primary == nil {
+		return fmt.Errorf("the database(%s) has no primary pool to migrate", d.name)
+	}
+
+	release, err := acquireMigrationLock(ctx, d.entry.primary)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = release() }()
+
+	if err := ensureMigrationsTable(ctx, d.entry.primary); err != nil {
+		return err
+	}
+
+	applied, err := loadAppliedMigrations(ctx, d.entry.primary)
+	if err != nil {
+		return err
+	}
+
+	if target != "" {
+		if _, ok := findMigration(d.client.migrations, target); !ok {
+			return fmt.Errorf("sqlxml: migration target %q not found", target)
+		}
+	}
+
+	for _, m := range d.client.migrations {
+		if rec, ok := applied[m.Version]; ok && rec.Checksum != m.Checksum {
+			return fmt.Errorf("sqlxml: migration %s checksum mismatch: applied version does not match the migration file, possible tampering", m.Version)
+		}
+	}
+
+	for _, m := range d.client.migrations {
+		if target != "" && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		if err := d.applyMigrationUp(ctx, m); err != nil {
+			return fmt.Errorf("sqlxml: migrating %s (%s) up: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the steps applied migrations with the highest
+// versions, in reverse version order.
+func (d *Database) MigrateDown(ctx context.Context, steps int) error {
+	if d.err != nil {
+		return d.err
+	}
+	if steps <= 0 {
+		return nil
+	}
+	if d.entry.primary == nil {
+		return fmt.Errorf("the database(%s) has no primary pool to migrate", d.name)
+	}
+
+	release, err := acquireMigrationLock(ctx, d.entry.primary)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = release() }()
+
+	if err := ensureMigrationsTable(ctx, d.entry.primary); err != nil {
+		return err
+	}
+
+	appliedVersions, err := loadAppliedVersionsDesc(ctx, d.entry.primary)
+	if err != nil {
+		return err
+	}
+
+	if steps > len(appliedVersions) {
+		steps = len(appliedVersions)
+	}
+
+	for _, version := range appliedVersions[:steps] {
+		m, ok := findMigration(d.client.migrations, version)
+		if !ok {
+			return fmt.Errorf("sqlxml: applied migration %s has no matching migration file", version)
+		}
+
+		if err := d.applyMigrationDown(ctx, m); err != nil {
+			return fmt.Errorf("sqlxml: migrating %s (%s) down: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationStatus reports every known migration and whether it has been
+// applied to d.
+func (d *Database) MigrationStatus(ctx context.Context) ([]MigrationInfo, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.entry.primary == nil {
+		return nil, fmt.Errorf("the database(%s) has no primary pool to check", d.name)
+	}
+
+	if err := ensureMigrationsTable(ctx, d.entry.primary); err != nil {
+		return nil, err
+	}
+
+	applied, err := loadAppliedMigrations(ctx, d.entry.primary)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]MigrationInfo, 0, len(d.client.migrations))
+	for _, m := range d.client.migrations {
+		info := MigrationInfo{Version: m.Version, Name: m.Name}
+		if rec, ok := applied[m.Version]; ok {
+			info.Applied = true
+			appliedAt := rec.AppliedAt
+			info.AppliedAt = &appliedAt
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func findMigration(migrations []*Migration, version string) (*Migration, bool) {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Database) applyMigrationUp(ctx context.Context, m *Migration) error {
+	if !m.UpTransactional {
+		if _, err := d.entry.primary.ExecContext(ctx, m.Up); err != nil {
+			return err
+		}
+		return recordMigrationApplied(ctx, d.entry.primary, m)
+	}
+
+	tx, err := d.entry.primary.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := recordMigrationApplied(ctx, tx, m); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *Database) applyMigrationDown(ctx context.Context, m *Migration) error {
+	if !m.DownTransactional {
+		if _, err := d.entry.primary.ExecContext(ctx, m.Down); err != nil {
+			return err
+		}
+		return recordMigrationReverted(ctx, d.entry.primary, m)
+	}
+
+	tx, err := d.entry.primary.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := recordMigrationReverted(ctx, tx, m); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//endregion
@@ -0,0 +1,150 @@
+package sqlxml
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//region schema_migrations bookkeeping
+
+const migrationsTableName = "schema_migrations"
+
+type appliedMigrationRecord struct {
+	Version   string    `db:"version"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// sqlExecer is satisfied by both *sqlx.DB and *sqlx.Tx, so recording a
+// migration's bookkeeping row works identically whether it runs inside the
+// migration's own transaction or, for a non-transactional migration,
+// directly against the connection. Rebind lets the "?" placeholders below
+// be rewritten to whatever bindvar syntax the driver actually wants (e.g.
+// "$1" for Postgres).
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	Rebind(query string) string
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sqlx.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+migrationsTableName+` (
+		version VARCHAR(255) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+func loadAppliedMigrations(ctx context.Context, db *sqlx.DB) (map[string]appliedMigrationRecord, error) {
+	var records []appliedMigrationRecord
+	if err := db.SelectContext(ctx, &records, `SELECT version, checksum, applied_at FROM `+migrationsTableName); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]appliedMigrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func loadAppliedVersionsDesc(ctx context.Context, db *sqlx.DB) ([]string, error) {
+	var versions []string
+	err := db.SelectContext(ctx, &versions, `SELECT version FROM `+migrationsTableName+` ORDER BY version DESC`)
+	return versions, err
+}
+
+func recordMigrationApplied(ctx context.Context, execer sqlExecer, m *Migration) error {
+	query := execer.Rebind(`INSERT INTO ` + migrationsTableName + ` (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`)
+	_, err := execer.ExecContext(ctx, query, m.Version, m.Name, m.Checksum, time.Now())
+	return err
+}
+
+func recordMigrationReverted(ctx context.Context, execer sqlExecer, m *Migration) error {
+	query := execer.Rebind(`DELETE FROM ` + migrationsTableName + ` WHERE version = ?`)
+	_, err := execer.ExecContext(ctx, query, m.Version)
+	return err
+}
+
+//endregion
+
+//region Advisory locks
+
+// acquireMigrationLock gates concurrent migrators on the same database.
+// Postgres and MySQL get a real session-scoped advisory lock; any other
+// driver falls back to a no-op, because neither sqlxml's advisory-lock
+// SQL nor a meaningful released-state check exists for a driver it can't
+// name ahead of time.
+//
+// Both locks are tied to the single connection that acquires them, so it
+// is checked out of the pool with db.Conn and held for the entire locked
+// section rather than released back after the acquiring statement:
+// running the unlock on a different pooled connection would leave the
+// original connection holding the lock indefinitely.
+func acquireMigrationLock(ctx context.Context, db *sqlx.DB) (release func() error, err error) {
+	switch db.DriverName() {
+	case "postgres", "pgx":
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		key := migrationLockKey()
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+			if closeErr := conn.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}, nil
+
+	case "mysql":
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		const name = "sqlxml_migrations"
+		var ok int
+		if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 10)`, name).Scan(&ok); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		if ok != 1 {
+			_ = conn.Close()
+			return nil, fmt.Errorf("sqlxml: could not acquire migration lock %q", name)
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, name)
+			if closeErr := conn.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}, nil
+
+	default:
+		return func() error { return nil }, nil
+	}
+}
+
+// migrationLockKey derives a stable int64 advisory-lock key from the
+// package's migrations namespace rather than using lock id 0. The key is the
+// same for every sqlxml client, so all of them migrating the same database
+// serialize on one lock.
+func migrationLockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("sqlxml_migrations"))
+	return int64(h.Sum64())
+}
+
+//endregion
@@ -0,0 +1,128 @@
+package sqlxml
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func newMockDatabase(t *testing.T, migrations []*Migration) (*Database, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = mockDB.Close() })
+
+	db := sqlx.NewDb(mockDB, "sqlmock")
+	entry := &databaseEntry{name: "default", primary: db}
+	client := &Client{
+		dbMap:      map[string]*databaseEntry{"default": entry},
+		migrations: migrations,
+		opt:        &Options{},
+	}
+
+	return client.Database("default"), mock
+}
+
+func TestMigrateAppliesInVersionOrderUpToTarget(t *testing.T) {
+	migrations := []*Migration{
+		{Version: "1", Name: "one", Checksum: "c1", Up: "CREATE TABLE a(id int)", UpTransactional: true},
+		{Version: "2", Name: "two", Checksum: "c2", Up: "CREATE TABLE b(id int)", UpTransactional: true},
+		{Version: "3", Name: "three", Checksum: "c3", Up: "CREATE TABLE c(id int)", UpTransactional: true},
+	}
+
+	d, mock := newMockDatabase(t, migrations)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO schema_migrations").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO schema_migrations").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := d.Migrate(context.Background(), "2"); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMigrateNoOpsWhenTargetAlreadyApplied(t *testing.T) {
+	migrations := []*Migration{
+		{Version: "1", Name: "one", Checksum: "c1", Up: "CREATE TABLE a(id int)"},
+		{Version: "2", Name: "two", Checksum: "c2", Up: "CREATE TABLE b(id int)"},
+	}
+
+	d, mock := newMockDatabase(t, migrations)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+			AddRow("1", "c1", time.Now()))
+
+	// target "1" is already applied, so Migrate must return without
+	// touching migration "2" at all (no CREATE TABLE b, no further exec).
+	if err := d.Migrate(context.Background(), "1"); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestMigrateUnknownTarget(t *testing.T) {
+	migrations := []*Migration{
+		{Version: "1", Name: "one", Checksum: "c1", Up: "CREATE TABLE a(id int)"},
+	}
+
+	d, mock := newMockDatabase(t, migrations)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, checksum, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}))
+
+	if err := d.Migrate(context.Background(), "99"); err == nil {
+		t.Fatal("expected an error for an unknown migration target, got nil")
+	}
+}
+
+func TestMigrateDownRevertsInReverseOrder(t *testing.T) {
+	migrations := []*Migration{
+		{Version: "1", Name: "one", Down: "DROP TABLE a", DownTransactional: true},
+		{Version: "2", Name: "two", Down: "DROP TABLE b", DownTransactional: true},
+	}
+
+	d, mock := newMockDatabase(t, migrations)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations ORDER BY version DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("2").AddRow("1"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM schema_migrations").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := d.MigrateDown(context.Background(), 1); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
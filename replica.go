@@ -0,0 +1,166 @@
+package sqlxml
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//region Read/write routing
+
+// databaseEntry holds every pool a <database> element resolves to: its
+// primary (nil only for a role="replica" element) and, if any
+// <replicas><replica> children were configured, a weighted pool of read
+// replicas.
+type databaseEntry struct {
+	name     string
+	primary  *sqlx.DB
+	replicas *replicaPool
+}
+
+// replicaSpec is the parsed-but-not-yet-opened form of a <replica>, used
+// while building a databaseEntry.
+type replicaSpec struct {
+	dsn    string
+	weight int
+}
+
+// replicaMember is one pool in a replicaPool's rotation, tracked healthy
+// until a lag/health probe (see Options.ReplicaLagCheckSQL) says otherwise.
+type replicaMember struct {
+	db      *sqlx.DB
+	weight  int
+	healthy atomic.Bool
+
+	progressMu     sync.Mutex
+	lastValue      string
+	lastAdvancedAt time.Time
+}
+
+func newReplicaMember(db *sqlx.DB, weight int) *replicaMember {
+	if weight <= 0 {
+		weight = 1
+	}
+	m := &replicaMember{db: db, weight: weight}
+	m.healthy.Store(true)
+	return m
+}
+
+// replicaPool is a weighted round-robin rotation over a database's read
+// replicas, skipping any member a health probe has marked unhealthy.
+type replicaPool struct {
+	mu      sync.Mutex
+	members []*replicaMember
+	cursor  int
+}
+
+func newReplicaPool(members []*replicaMember) *replicaPool {
+	return &replicaPool{members: members}
+}
+
+// next returns the next pool in rotation, weighted by each healthy
+// member's configured weight. It returns nil when every replica is
+// unhealthy, so callers fall back to the primary.
+func (p *replicaPool) next() *sqlx.DB {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	totalWeight := 0
+	for _, m := range p.members {
+		if m.healthy.Load() {
+			totalWeight += m.weight
+		}
+	}
+	if totalWeight == 0 {
+		return nil
+	}
+
+	p.cursor = (p.cursor + 1) % totalWeight
+	target := p.cursor
+	for _, m := range p.members {
+		if !m.healthy.Load() {
+			continue
+		}
+		if target < m.weight {
+			return m.db
+		}
+		target -= m.weight
+	}
+
+	// Unreachable in practice: totalWeight accounts for exactly the healthy
+	// members walked above.
+	return nil
+}
+
+// replicaStaleAfter bounds how long a member's probeSQL result may stay
+// unchanged before checkHealth considers replication stalled. probeSQL is
+// expected to return a value that advances as the replica catches up (e.g.
+// Postgres's pg_last_wal_replay_lsn()); sqlxml has no way to parse that
+// value's driver-specific format, but a replica whose reading hasn't moved
+// across several checks has stopped applying writes regardless of format,
+// so tracking whether it changed is enough to catch real lag.
+const replicaStaleAfter = 3 * defaultReplicaHealthCheckInterval
+
+// checkHealth runs probeSQL against every member. A member is marked
+// unhealthy if the probe errors outright, or if its result hasn't changed
+// in replicaStaleAfter - i.e. replication has stalled rather than merely
+// being slow.
+func (p *replicaPool) checkHealth(probeSQL string) {
+	now := time.Now()
+
+	for _, m := range p.members {
+		var probeResult any
+		if err := m.db.Get(&probeResult, probeSQL); err != nil {
+			m.healthy.Store(false)
+			continue
+		}
+
+		value := fmt.Sprintf("%v", probeResult)
+
+		m.progressMu.Lock()
+		if m.lastAdvancedAt.IsZero() || value != m.lastValue {
+			m.lastValue = value
+			m.lastAdvancedAt = now
+		}
+		stale := now.Sub(m.lastAdvancedAt) > replicaStaleAfter
+		m.progressMu.Unlock()
+
+		m.healthy.Store(!stale)
+	}
+}
+
+//endregion
+
+//region Replica health checks
+
+// defaultReplicaHealthCheckInterval is how often Options.ReplicaLagCheckSQL
+// is re-run against every replica.
+const defaultReplicaHealthCheckInterval = 30 * time.Second
+
+// startReplicaHealthChecks runs probeSQL against every replica in dbMap on
+// a timer until stop is closed.
+func startReplicaHealthChecks(dbMap map[string]*databaseEntry, probeSQL string, stop <-chan struct{}) {
+	ticker := time.NewTicker(defaultReplicaHealthCheckInterval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, entry := range dbMap {
+					if entry.replicas != nil {
+						entry.replicas.checkHealth(probeSQL)
+					}
+				}
+			}
+		}
+	}()
+}
+
+//endregion
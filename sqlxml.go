@@ -6,8 +6,11 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -26,6 +29,50 @@ type Options struct {
 	ScriptsGlobFiles string
 	Env              string
 	DsnDecryptFunc   func(dsn string) string
+
+	// StmtCacheSize bounds each pool's LRU cache of prepared named
+	// statements (a database's primary and every replica get their own
+	// cache). Zero uses defaultStmtCacheSize.
+	StmtCacheSize int
+
+	// WatchScripts, when true, makes NewClient watch every file matched by
+	// ScriptsGlobFiles (via fsnotify) and hot-reload scriptMap on change.
+	WatchScripts bool
+
+	// FS, when set, resolves DatabaseFile and ScriptsGlobFiles through it
+	// (via fs.ReadFile/fs.Glob) instead of the local disk, so callers can
+	// embed their XML with embed.FS. Nil falls back to disk.
+	FS fs.FS
+
+	// MigrationsGlobFiles, when set, loads XML-defined schema migrations
+	// (see migrate.go) that Database.Migrate/MigrateDown/MigrationStatus
+	// operate on.
+	MigrationsGlobFiles string
+
+	// ReplicaLagCheckSQL, when set, is run periodically (see replica.go)
+	// against every configured replica. A replica whose probe errors, or
+	// whose probe result has not changed for replicaStaleAfter, is marked
+	// unhealthy and removed from the read rotation until a later probe
+	// succeeds with a result that is no longer stale.
+	ReplicaLagCheckSQL string
+
+	// MaxBatchRows bounds how many rows Database.ExecMany folds into a
+	// single multi-row INSERT statement. Zero uses defaultMaxBatchRows.
+	MaxBatchRows int
+
+	// MaxBatchParams bounds how many bound parameters a single ExecMany
+	// statement may use, so a batch never exceeds the driver's placeholder
+	// limit (e.g. MySQL and Postgres allow 65535, SQL Server 2100). Zero
+	// uses defaultMaxBatchParams.
+	MaxBatchParams int
+
+	// PgCopyFunc, when set, lets ExecMany bypass multi-row INSERT in favor
+	// of a Postgres COPY for batches run against a "pgx" pool. Actually
+	// issuing a COPY means calling pgx's CopyFrom, which this package isn't
+	// willing to import just for one optional code path, so callers wire
+	// it up themselves; ExecMany only calls it with the target table, its
+	// columns, and each row's values in that column order.
+	PgCopyFunc func(ctx context.Context, conn *sql.Conn, table string, columns []string, rows [][]any) (int64, error)
 }
 
 //endregion
@@ -37,15 +84,30 @@ type databasesXml struct {
 }
 
 type databaseXml struct {
-	XMLName                xml.Name `xml:"database"`
-	Name                   string   `xml:"name,attr"`
-	Driver                 string   `xml:"driver,attr"`
-	Dsn                    string   `xml:"dsn,attr"`
-	Env                    string   `xml:"env,attr"`
-	MaxIdleConns           *int     `xml:"maxIdleConns,attr"`
-	MaxOpenConns           *int     `xml:"maxOpenConns,attr"`
-	ConnMaxLifetimeSeconds *int     `xml:"connMaxLifetimeSeconds,attr"`
-	ConnMaxIdleTimeSeconds *int     `xml:"connMaxIdleTimeSeconds,attr"`
+	XMLName                xml.Name     `xml:"database"`
+	Name                   string       `xml:"name,attr"`
+	Driver                 string       `xml:"driver,attr"`
+	Dsn                    string       `xml:"dsn,attr"`
+	Env                    string       `xml:"env,attr"`
+	Role                   string       `xml:"role,attr"`
+	MaxIdleConns           *int         `xml:"maxIdleConns,attr"`
+	MaxOpenConns           *int         `xml:"maxOpenConns,attr"`
+	ConnMaxLifetimeSeconds *int         `xml:"connMaxLifetimeSeconds,attr"`
+	ConnMaxIdleTimeSeconds *int         `xml:"connMaxIdleTimeSeconds,attr"`
+	Replicas               *replicasXml `xml:"replicas"`
+}
+
+// replicasXml lists read replicas for a <database>. Each <replica> reuses
+// its parent's driver and pool-size settings; only the DSN and weight vary.
+type replicasXml struct {
+	XMLName  xml.Name     `xml:"replicas"`
+	Replicas []replicaXml `xml:"replica"`
+}
+
+type replicaXml struct {
+	XMLName xml.Name `xml:"replica"`
+	Dsn     string   `xml:"dsn,attr"`
+	Weight  *int     `xml:"weight,attr"`
 }
 
 type scriptsXml struct {
@@ -56,7 +118,7 @@ type scriptsXml struct {
 type scriptXml struct {
 	XMLName xml.Name `xml:"script"`
 	Name    string   `xml:"name,attr"`
-	Content string   `xml:",chardata"`
+	Content string   `xml:",innerxml"`
 }
 
 //endregion
@@ -64,22 +126,60 @@ type scriptXml struct {
 //region Client
 
 type Client struct {
-	dbMap     map[string]*sqlx.DB
-	scriptMap map[string]string
-	err       error
+	dbMap      map[string]*databaseEntry
+	scriptMap  atomic.Pointer[map[string]*compiledScript]
+	migrations []*Migration
+	opt        *Options
+	err        error
+
+	stmtCacheMu sync.Mutex
+	stmtCaches  map[*sqlx.DB]*stmtCache
+
+	watcher         *fsnotifyWatcher
+	reloadMu        sync.Mutex
+	reloadCallbacks []func(added, changed, removed []string)
+
+	replicaHealthStop chan struct{}
 }
 
 func (c *Client) Error() error {
 	return c.err
 }
 
+// scripts returns the currently active script map. It is safe to call
+// concurrently with ReloadScripts.
+func (c *Client) scripts() map[string]*compiledScript {
+	if m := c.scriptMap.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// cacheFor returns pool's prepared-statement cache, creating it on first
+// use. Each physical *sqlx.DB (a database's primary, or one of its
+// replicas) gets its own cache, since a *sqlx.NamedStmt only prepares
+// against the pool it came from.
+func (c *Client) cacheFor(pool *sqlx.DB) *stmtCache {
+	c.stmtCacheMu.Lock()
+	defer c.stmtCacheMu.Unlock()
+
+	if cache, ok := c.stmtCaches[pool]; ok {
+		return cache
+	}
+
+	cache := newStmtCache(c.opt.StmtCacheSize)
+	c.stmtCaches[pool] = cache
+	return cache
+}
+
 func (c *Client) Database(dbName string) *Database {
 	d := &Database{
 		client: c,
+		name:   dbName,
 	}
 
-	if db, ok := c.dbMap[dbName]; ok {
-		d.db = db
+	if entry, ok := c.dbMap[dbName]; ok {
+		d.entry = entry
 	} else {
 		d.err = fmt.Errorf("the database name(%s) is not found", dbName)
 	}
@@ -88,7 +188,7 @@ func (c *Client) Database(dbName string) *Database {
 }
 
 func NewClient(opt *Options) *Client {
-	c := &Client{}
+	c := &Client{opt: opt}
 	if opt.DatabaseFile == "" {
 		c.err = errors.New("DatabaseFile is required")
 		return c
@@ -110,7 +210,30 @@ func NewClient(opt *Options) *Client {
 		c.err = err
 		return c
 	} else {
-		c.scriptMap = scriptMap
+		c.scriptMap.Store(&scriptMap)
+	}
+
+	c.stmtCaches = make(map[*sqlx.DB]*stmtCache)
+
+	if opt.ReplicaLagCheckSQL != "" {
+		c.replicaHealthStop = make(chan struct{})
+		startReplicaHealthChecks(c.dbMap, opt.ReplicaLagCheckSQL, c.replicaHealthStop)
+	}
+
+	if opt.WatchScripts {
+		if err := c.startWatch(); err != nil {
+			c.err = err
+			return c
+		}
+	}
+
+	if opt.MigrationsGlobFiles != "" {
+		migrations, err := loadMigrationsGlobFiles(opt)
+		if err != nil {
+			c.err = err
+			return c
+		}
+		c.migrations = migrations
 	}
 
 	return c
@@ -121,43 +244,70 @@ func NewClient(opt *Options) *Client {
 //region Database
 
 type Database struct {
-	client *Client
-	db     *sqlx.DB
-	err    error
+	client       *Client
+	name         string
+	entry        *databaseEntry
+	forcePrimary bool
+	err          error
 }
 
 func (d *Database) Error() error {
 	return d.err
 }
 
-func (d *Database) QueryRow(ctx context.Context, scriptName string, arg any, result any) error {
-	nStmt, err := GetNStmt(ctx, d, scriptName)
-	if err != nil {
-		return err
+// Reader returns a Database bound to this database's replica pool (round-
+// robin across healthy replicas, falling back to the primary when there
+// are none), regardless of the handle it was called on.
+func (d *Database) Reader() *Database {
+	nd := *d
+	nd.forcePrimary = false
+	return &nd
+}
+
+// Writer returns a Database that always runs QueryRow/QueryRows/Exec
+// against the primary, bypassing replica routing.
+func (d *Database) Writer() *Database {
+	nd := *d
+	nd.forcePrimary = true
+	return &nd
+}
+
+// resolveDB picks the pool a call should run against: the primary for
+// forWrite (or a handle obtained via Writer()), otherwise a replica chosen
+// by the database's replicaPool when one is configured.
+func (d *Database) resolveDB(forWrite bool) (*sqlx.DB, error) {
+	if !forWrite && !d.forcePrimary && d.entry.replicas != nil {
+		if pool := d.entry.replicas.next(); pool != nil {
+			return pool, nil
+		}
 	}
-	defer func() { _ = nStmt.Close() }()
 
-	return nStmt.GetContext(ctx, result, arg)
+	if d.entry.primary == nil {
+		return nil, fmt.Errorf("the database(%s) has no primary pool", d.name)
+	}
+	return d.entry.primary, nil
 }
 
-func (d *Database) QueryRowByMap(ctx context.Context, scriptName string, arg map[string]any, result any) error {
-	nStmt, err := GetNStmt(ctx, d, scriptName)
+func (d *Database) QueryRow(ctx context.Context, scriptName string, arg any, result any) error {
+	nStmt, params, err := d.prepareNStmt(ctx, scriptName, arg, false)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = nStmt.Close() }()
 
-	return nStmt.GetContext(ctx, result, arg)
+	return nStmt.GetContext(ctx, result, params)
+}
+
+func (d *Database) QueryRowByMap(ctx context.Context, scriptName string, arg map[string]any, result any) error {
+	return d.QueryRow(ctx, scriptName, arg, result)
 }
 
 func (d *Database) QueryRows(ctx context.Context, scriptName string, arg any, result any) error {
-	nStmt, err := GetNStmt(ctx, d, scriptName)
+	nStmt, params, err := d.prepareNStmt(ctx, scriptName, arg, false)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = nStmt.Close() }()
 
-	return nStmt.SelectContext(ctx, result, arg)
+	return nStmt.SelectContext(ctx, result, params)
 }
 
 func (d *Database) QueryRowsByMap(ctx context.Context, scriptName string, arg map[string]any, result any) error {
@@ -165,30 +315,142 @@ func (d *Database) QueryRowsByMap(ctx context.Context, scriptName string, arg ma
 }
 
 func (d *Database) Exec(ctx context.Context, scriptName string, arg any) (sql.Result, error) {
-	nStmt, err := GetNStmt(ctx, d, scriptName)
+	nStmt, params, err := d.prepareNStmt(ctx, scriptName, arg, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return nStmt.ExecContext(ctx, params)
+}
+
+// BeginTx starts a transaction and returns a Tx exposing the same
+// QueryRow/QueryRows/Exec surface as Database, bound to the transaction.
+// Transactions always run against the primary.
+func (d *Database) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	pool, err := d.resolveDB(true)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pool.BeginTxx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = nStmt.Close() }()
 
-	return nStmt.ExecContext(ctx, arg)
+	return &Tx{database: d, tx: tx}, nil
 }
 
-func GetNStmt(ctx context.Context, d *Database, scriptName string) (*sqlx.NamedStmt, error) {
-	script, ok := d.client.scriptMap[scriptName]
+// RunInTx runs fn inside a transaction, committing on a nil return and
+// rolling back otherwise. Failures whose error text looks like a
+// serialization conflict (see isSerializationFailure) are retried with the
+// same options, up to maxTxRetries times.
+func (d *Database) RunInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		tx, err := d.BeginTx(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		err = fn(tx)
+		if err != nil {
+			_ = tx.tx.Rollback()
+			if isSerializationFailure(err) && attempt < maxTxRetries {
+				continue
+			}
+			return err
+		}
+
+		if err := tx.tx.Commit(); err != nil {
+			if isSerializationFailure(err) && attempt < maxTxRetries {
+				continue
+			}
+			return err
+		}
+
+		return nil
+	}
+}
+
+// GetNStmt renders scriptName's dynamic SQL tags against arg and returns a
+// prepared named statement against d's read pool, together with the
+// expanded parameter map (arg's fields plus any synthesized foreach
+// parameters) to execute it with. It is the read-path equivalent of what
+// Database.Exec does for writes; see Database.prepareNStmt.
+func GetNStmt(ctx context.Context, d *Database, scriptName string, arg any) (*sqlx.NamedStmt, map[string]any, error) {
+	return d.prepareNStmt(ctx, scriptName, arg, false)
+}
+
+// prepareNStmt renders scriptName against arg, resolves the pool the call
+// should run against (primary for forWrite, otherwise a replica when
+// configured), and returns a prepared named statement served from that
+// pool's LRU cache so repeat calls skip PrepareNamedContext.
+func (d *Database) prepareNStmt(ctx context.Context, scriptName string, arg any, forWrite bool) (*sqlx.NamedStmt, map[string]any, error) {
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+
+	script, ok := d.client.scripts()[scriptName]
 	if !ok {
-		return nil, ErrNoScript
+		return nil, nil, ErrNoScript
+	}
+
+	sqlText, params, err := script.render(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool, err := d.resolveDB(forWrite)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return d.db.PrepareNamedContext(ctx, script)
+	cache := d.client.cacheFor(pool)
+	cacheKey := stmtCacheKey(scriptName, sqlText)
+	if nStmt, ok := cache.get(cacheKey); ok {
+		return nStmt, params, nil
+	}
+
+	nStmt, err := pool.PrepareNamedContext(ctx, sqlText)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// put may discover another goroutine already cached a statement for
+	// cacheKey (both missed the cold cache concurrently); in that case it
+	// closes nStmt and returns the one that won, which callers must use
+	// instead of nStmt itself.
+	nStmt = cache.put(cacheKey, nStmt)
+	return nStmt, params, nil
 }
 
 //endregion
 
 //region Util
 
-func loadDatabasesFile(opt *Options) (map[string]*sqlx.DB, error) {
-	file, err := ioutil.ReadFile(opt.DatabaseFile)
+// readFile resolves path through opt.FS when set, otherwise reads it from
+// local disk.
+func readFile(opt *Options, path string) ([]byte, error) {
+	if opt.FS != nil {
+		return fs.ReadFile(opt.FS, path)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// globFiles resolves pattern through opt.FS when set, otherwise globs local
+// disk.
+func globFiles(opt *Options, pattern string) ([]string, error) {
+	if opt.FS != nil {
+		return fs.Glob(opt.FS, pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+func loadDatabasesFile(opt *Options) (map[string]*databaseEntry, error) {
+	file, err := readFile(opt, opt.DatabaseFile)
 	if err != nil {
 		return nil, err
 	}
@@ -203,52 +465,109 @@ func loadDatabasesFile(opt *Options) (map[string]*sqlx.DB, error) {
 		return nil, errors.New("no available database")
 	}
 
-	databaseMap := make(map[string]*sqlx.DB)
+	databaseMap := make(map[string]*databaseEntry)
 	for _, dbXml := range data.Databases {
 		if opt.Env != "" && opt.Env != dbXml.Env {
 			continue
 		}
 
-		dsn := dbXml.Dsn
+		entry, err := buildDatabaseEntry(opt, dbXml)
+		if err != nil {
+			return nil, err
+		}
+
+		databaseMap[dbXml.Name] = entry
+	}
+
+	return databaseMap, nil
+}
+
+// buildDatabaseEntry opens the pools a <database> element describes: its
+// own primary pool (unless role="replica", in which case it has none), plus
+// one pool per <replicas><replica> child. Every pool shares the parent
+// element's driver and pool-size settings.
+func buildDatabaseEntry(opt *Options, dbXml databaseXml) (*databaseEntry, error) {
+	open := func(dsn string) (*sqlx.DB, error) {
 		if opt.DsnDecryptFunc != nil {
-			dsn = opt.DsnDecryptFunc(dbXml.Dsn)
+			dsn = opt.DsnDecryptFunc(dsn)
 		}
 
 		db, err := sqlx.Open(dbXml.Driver, dsn)
 		if err != nil {
 			return nil, err
 		}
+		applyPoolSettings(db, dbXml)
+		return db, nil
+	}
 
-		if dbXml.MaxOpenConns != nil {
-			db.SetMaxOpenConns(*dbXml.MaxOpenConns)
-		}
+	entry := &databaseEntry{name: dbXml.Name}
 
-		if dbXml.MaxIdleConns != nil {
-			db.SetMaxIdleConns(*dbXml.MaxIdleConns)
+	var replicaSpecs []replicaSpec
+	if dbXml.Role == "replica" {
+		replicaSpecs = append(replicaSpecs, replicaSpec{dsn: dbXml.Dsn, weight: 1})
+	} else {
+		primary, err := open(dbXml.Dsn)
+		if err != nil {
+			return nil, err
 		}
-
-		if dbXml.ConnMaxLifetimeSeconds != nil {
-			seconds := time.Duration(*dbXml.ConnMaxLifetimeSeconds)
-			db.SetConnMaxLifetime(seconds * time.Second)
+		entry.primary = primary
+
+		if dbXml.Replicas != nil {
+			for _, r := range dbXml.Replicas.Replicas {
+				weight := 1
+				if r.Weight != nil {
+					weight = *r.Weight
+				}
+				replicaSpecs = append(replicaSpecs, replicaSpec{dsn: r.Dsn, weight: weight})
+			}
 		}
+	}
 
-		if dbXml.ConnMaxLifetimeSeconds != nil {
-			seconds := time.Duration(*dbXml.ConnMaxLifetimeSeconds)
-			db.SetConnMaxIdleTime(seconds * time.Second)
+	if len(replicaSpecs) > 0 {
+		members := make([]*replicaMember, 0, len(replicaSpecs))
+		for _, spec := range replicaSpecs {
+			db, err := open(spec.dsn)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, newReplicaMember(db, spec.weight))
 		}
+		entry.replicas = newReplicaPool(members)
+	}
 
-		databaseMap[dbXml.Name] = db
+	return entry, nil
+}
+
+func applyPoolSettings(db *sqlx.DB, dbXml databaseXml) {
+	if dbXml.MaxOpenConns != nil {
+		db.SetMaxOpenConns(*dbXml.MaxOpenConns)
 	}
 
-	return databaseMap, nil
+	if dbXml.MaxIdleConns != nil {
+		db.SetMaxIdleConns(*dbXml.MaxIdleConns)
+	}
+
+	if dbXml.ConnMaxLifetimeSeconds != nil {
+		seconds := time.Duration(*dbXml.ConnMaxLifetimeSeconds)
+		db.SetConnMaxLifetime(seconds * time.Second)
+	}
+
+	if dbXml.ConnMaxIdleTimeSeconds != nil {
+		seconds := time.Duration(*dbXml.ConnMaxIdleTimeSeconds)
+		db.SetConnMaxIdleTime(seconds * time.Second)
+	}
 }
 
-func loadScriptsGlobFiles(opt *Options) (map[string]string, error) {
-	var scriptMap map[string]string
+func loadScriptsGlobFiles(opt *Options) (map[string]*compiledScript, error) {
+	scriptMap := make(map[string]*compiledScript)
+
+	scriptFilePathList, err := globFiles(opt, opt.ScriptsGlobFiles)
+	if err != nil {
+		return nil, err
+	}
 
-	scriptFilePathList, _ := filepath.Glob(opt.ScriptsGlobFiles)
 	for _, scriptFilePath := range scriptFilePathList {
-		fileContent, err := ioutil.ReadFile(scriptFilePath)
+		fileContent, err := readFile(opt, scriptFilePath)
 		if err != nil {
 			return nil, err
 		}
@@ -262,9 +581,13 @@ func loadScriptsGlobFiles(opt *Options) (map[string]string, error) {
 		for _, script := range data.Scripts {
 			if _, ok := scriptMap[script.Name]; ok {
 				return nil, fmt.Errorf("the script name(%s) is duplicate", script.Name)
-			} else {
-				scriptMap[script.Name] = script.Content
 			}
+
+			compiled, err := compileScript(script.Content)
+			if err != nil {
+				return nil, fmt.Errorf("the script name(%s) failed to parse: %w", script.Name, err)
+			}
+			scriptMap[script.Name] = compiled
 		}
 	}
 
@@ -0,0 +1,119 @@
+package sqlxml
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//region Statement cache
+
+// defaultStmtCacheSize is used when Options.StmtCacheSize is zero.
+const defaultStmtCacheSize = 128
+
+// stmtCache is a size-bounded LRU cache of prepared named statements for a
+// single *sqlx.DB. Keys are scriptName plus the SQL text it rendered to,
+// since a dynamic script (see dynamic.go) can render different SQL for the
+// same scriptName depending on the call's arg, e.g. a <foreach> over a
+// slice whose length varies between calls.
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type stmtCacheEntry struct {
+	key  string
+	stmt *sqlx.NamedStmt
+}
+
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		size = defaultStmtCacheSize
+	}
+
+	return &stmtCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// stmtCacheKey builds a cache key that varies with both the script and the
+// SQL it rendered to.
+func stmtCacheKey(scriptName, sqlText string) string {
+	return scriptName + "\x00" + sqlText
+}
+
+func (c *stmtCache) get(key string) (*sqlx.NamedStmt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return el.Value.(*stmtCacheEntry).stmt, true
+}
+
+// put caches stmt under key, unless a concurrent caller already cached one
+// for the same key first — in that case stmt is redundant (another
+// goroutine raced this one through a cold cache and prepared the same
+// statement), so it's closed rather than stored, and the entry already in
+// the cache is kept. Callers must use the returned *sqlx.NamedStmt rather
+// than assuming stmt itself is what stayed cached.
+func (c *stmtCache) put(key string, stmt *sqlx.NamedStmt) *sqlx.NamedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*stmtCacheEntry)
+		if entry.stmt != stmt {
+			_ = stmt.Close()
+		}
+		return entry.stmt
+	}
+
+	el := c.order.PushFront(&stmtCacheEntry{key: key, stmt: stmt})
+	c.entries[key] = el
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.evict(oldest)
+	}
+
+	return stmt
+}
+
+func (c *stmtCache) evict(el *list.Element) {
+	entry := el.Value.(*stmtCacheEntry)
+	_ = entry.stmt.Close()
+	delete(c.entries, entry.key)
+	c.order.Remove(el)
+}
+
+// removeScript evicts every cached statement prepared for scriptName,
+// regardless of which rendered SQL text it was keyed under. Used on reload
+// to drop statements compiled from a script's old source.
+func (c *stmtCache) removeScript(scriptName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := scriptName + "\x00"
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.evict(el)
+		}
+	}
+}
+
+//endregion
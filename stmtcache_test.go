@@ -0,0 +1,84 @@
+package sqlxml
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+// TestStmtCachePutConcurrentColdMiss reproduces two goroutines racing a cold
+// cache entry for the same key, each having already prepared its own
+// *sqlx.NamedStmt before calling put (mirroring prepareNStmt's
+// PrepareNamedContext-then-put sequence in sqlxml.go). Run with -race: the
+// old put() closed whichever stmt it found already cached, which could be
+// the winner a concurrent caller was still about to execute, rather than
+// the redundant loser. put must instead return whichever stmt actually
+// stayed cached, and only the other one may be closed.
+func TestStmtCachePutConcurrentColdMiss(t *testing.T) {
+	const sqlText = `SELECT id FROM users WHERE id = :id`
+	const key = "getUser\x00" + sqlText
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = mockDB.Close() })
+	db := sqlx.NewDb(mockDB, "sqlmock")
+
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectPrepare(`SELECT id FROM users WHERE id = \?`)
+	mock.ExpectPrepare(`SELECT id FROM users WHERE id = \?`)
+
+	stmtA, err := db.PrepareNamedContext(context.Background(), sqlText)
+	if err != nil {
+		t.Fatalf("PrepareNamedContext (A) failed: %v", err)
+	}
+	stmtB, err := db.PrepareNamedContext(context.Background(), sqlText)
+	if err != nil {
+		t.Fatalf("PrepareNamedContext (B) failed: %v", err)
+	}
+
+	cache := newStmtCache(10)
+
+	var wg sync.WaitGroup
+	won := make([]*sqlx.NamedStmt, 2)
+	wg.Add(2)
+	go func() { defer wg.Done(); won[0] = cache.put(key, stmtA) }()
+	go func() { defer wg.Done(); won[1] = cache.put(key, stmtB) }()
+	wg.Wait()
+
+	if won[0] != won[1] {
+		t.Fatalf("concurrent put calls returned different stmts: %p vs %p", won[0], won[1])
+	}
+	winner := won[0]
+
+	cached, ok := cache.get(key)
+	if !ok {
+		t.Fatal("expected an entry to be cached under key")
+	}
+	if cached != winner {
+		t.Fatalf("cache holds %p but put returned %p", cached, winner)
+	}
+
+	loser := stmtA
+	if winner == stmtA {
+		loser = stmtB
+	}
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE id = \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	var result struct {
+		ID int `db:"id"`
+	}
+	if err := winner.GetContext(context.Background(), &result, map[string]any{"id": 1}); err != nil {
+		t.Fatalf("the winning stmt must still be usable: %v", err)
+	}
+
+	if err := loser.GetContext(context.Background(), &result, map[string]any{"id": 1}); err == nil {
+		t.Fatal("expected the superseded stmt to have been closed")
+	}
+}
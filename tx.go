@@ -0,0 +1,108 @@
+package sqlxml
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//region Tx
+
+// maxTxRetries bounds how many times RunInTx retries a transaction whose
+// commit or body failed on a serialization conflict.
+const maxTxRetries = 3
+
+// Tx mirrors Database's QueryRow/QueryRows/Exec surface but runs every
+// statement through the transaction's own connection via sqlx.Tx. Unlike
+// Database, statements are prepared fresh against the tx each call rather
+// than served from the shared *stmtCache, since a tx-bound *sqlx.NamedStmt
+// is only valid for the lifetime of that one transaction.
+type Tx struct {
+	database *Database
+	tx       *sqlx.Tx
+}
+
+func (t *Tx) getNStmt(ctx context.Context, scriptName string, arg any) (*sqlx.NamedStmt, map[string]any, error) {
+	script, ok := t.database.client.scripts()[scriptName]
+	if !ok {
+		return nil, nil, ErrNoScript
+	}
+
+	sqlText, params, err := script.render(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nStmt, err := t.tx.PrepareNamedContext(ctx, sqlText)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nStmt, params, nil
+}
+
+func (t *Tx) QueryRow(ctx context.Context, scriptName string, arg any, result any) error {
+	nStmt, params, err := t.getNStmt(ctx, scriptName, arg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = nStmt.Close() }()
+
+	return nStmt.GetContext(ctx, result, params)
+}
+
+func (t *Tx) QueryRowByMap(ctx context.Context, scriptName string, arg map[string]any, result any) error {
+	return t.QueryRow(ctx, scriptName, arg, result)
+}
+
+func (t *Tx) QueryRows(ctx context.Context, scriptName string, arg any, result any) error {
+	nStmt, params, err := t.getNStmt(ctx, scriptName, arg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = nStmt.Close() }()
+
+	return nStmt.SelectContext(ctx, result, params)
+}
+
+func (t *Tx) QueryRowsByMap(ctx context.Context, scriptName string, arg map[string]any, result any) error {
+	return t.QueryRows(ctx, scriptName, arg, result)
+}
+
+func (t *Tx) Exec(ctx context.Context, scriptName string, arg any) (sql.Result, error) {
+	nStmt, params, err := t.getNStmt(ctx, scriptName, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = nStmt.Close() }()
+
+	return nStmt.ExecContext(ctx, params)
+}
+
+// isSerializationFailure reports whether err looks like a driver's
+// serialization-conflict error (Postgres SQLSTATE 40001, MySQL deadlock/lock
+// wait timeout). There's no shared error type across database/sql drivers
+// to type-assert against, so this matches on the message text instead.
+func isSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "40001"):
+		return true
+	case strings.Contains(msg, "serialization failure"):
+		return true
+	case strings.Contains(msg, "deadlock"):
+		return true
+	case strings.Contains(msg, "lock wait timeout"):
+		return true
+	default:
+		return false
+	}
+}
+
+//endregion
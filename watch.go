@@ -0,0 +1,177 @@
+package sqlxml
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+//region Hot reload
+
+// fsnotifyWatcher keeps Client's exported surface free of a direct fsnotify
+// import; everything that touches it lives in this file.
+type fsnotifyWatcher = fsnotify.Watcher
+
+// reloadDebounce coalesces bursts of filesystem events (e.g. an editor's
+// write-then-rename save) into a single reload.
+const reloadDebounce = 100 * time.Millisecond
+
+// startWatch watches every directory holding a file matched by
+// ScriptsGlobFiles (so newly created files are picked up too) and reloads
+// scriptMap whenever one of them changes.
+func (c *Client) startWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]struct{}{}
+	paths, _ := filepath.Glob(c.opt.ScriptsGlobFiles)
+	for _, p := range paths {
+		dirs[filepath.Dir(p)] = struct{}{}
+	}
+	if len(dirs) == 0 {
+		dirs[filepath.Dir(c.opt.ScriptsGlobFiles)] = struct{}{}
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	c.watcher = watcher
+	go c.watchLoop()
+
+	return nil
+}
+
+func (c *Client) watchLoop() {
+	debounce := time.NewTimer(reloadDebounce)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+
+	for {
+		select {
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+
+		case <-debounce.C:
+			_ = c.ReloadScripts()
+
+		case _, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the background goroutines started by Options.WatchScripts and
+// Options.ReplicaLagCheckSQL, if any. It is a no-op otherwise.
+func (c *Client) Close() error {
+	if c.replicaHealthStop != nil {
+		close(c.replicaHealthStop)
+	}
+
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Close()
+}
+
+// ReloadScripts re-parses every file matched by ScriptsGlobFiles and, if
+// the result looks sane, atomically swaps it in for the active script map.
+// A staged reload is rejected, leaving the previous set in place, if it
+// produces zero scripts or if it drops a script name the previous set
+// resolved (an in-flight caller could be about to look that name up).
+// With WatchScripts, the watcher calls this once per debounced burst of
+// write/create/remove/rename events; it can also be called directly to
+// force a reload.
+func (c *Client) ReloadScripts() error {
+	staging, err := loadScriptsGlobFiles(c.opt)
+	if err != nil {
+		return err
+	}
+
+	previous := c.scripts()
+	if len(staging) == 0 && len(previous) > 0 {
+		return errors.New("sqlxml: reload produced zero scripts, keeping the previous set")
+	}
+
+	added, changed, removed := diffScriptMaps(previous, staging)
+	if len(removed) > 0 {
+		return fmt.Errorf("sqlxml: reload would drop previously resolvable script(s) %v, keeping the previous set", removed)
+	}
+
+	c.scriptMap.Store(&staging)
+
+	c.stmtCacheMu.Lock()
+	for _, cache := range c.stmtCaches {
+		for _, name := range changed {
+			cache.removeScript(name)
+		}
+	}
+	c.stmtCacheMu.Unlock()
+
+	c.notifyReloaded(added, changed, nil)
+	return nil
+}
+
+// OnScriptsReloaded registers fn to be called after every reload that
+// actually changed something, with the names of scripts added and changed
+// since the previous script map. removed is always empty, because
+// ReloadScripts rejects any reload that would drop a script.
+func (c *Client) OnScriptsReloaded(fn func(added, changed, removed []string)) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	c.reloadCallbacks = append(c.reloadCallbacks, fn)
+}
+
+func (c *Client) notifyReloaded(added, changed, removed []string) {
+	if len(added) == 0 && len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	c.reloadMu.Lock()
+	callbacks := append([]func(added, changed, removed []string){}, c.reloadCallbacks...)
+	c.reloadMu.Unlock()
+
+	for _, cb := range callbacks {
+		cb(added, changed, removed)
+	}
+}
+
+func diffScriptMaps(oldMap, newMap map[string]*compiledScript) (added, changed, removed []string) {
+	for name, script := range newMap {
+		old, ok := oldMap[name]
+		if !ok {
+			added = append(added, name)
+			continue
+		}
+		if old.source != script.source {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range oldMap {
+		if _, ok := newMap[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	return added, changed, removed
+}
+
+//endregion
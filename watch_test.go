@@ -0,0 +1,68 @@
+package sqlxml
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestClientForReload(t *testing.T, fsys fstest.MapFS) *Client {
+	t.Helper()
+
+	opt := &Options{ScriptsGlobFiles: "scripts/*.xml", FS: fsys}
+
+	scriptMap, err := loadScriptsGlobFiles(opt)
+	if err != nil {
+		t.Fatalf("loadScriptsGlobFiles failed: %v", err)
+	}
+
+	c := &Client{opt: opt, stmtCaches: make(map[*sqlx.DB]*stmtCache)}
+	c.scriptMap.Store(&scriptMap)
+
+	return c
+}
+
+func TestReloadScriptsRejectsDroppedScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"scripts/a.xml": {Data: []byte(`<scripts><script name="getUser">SELECT 1</script></scripts>`)},
+	}
+	c := newTestClientForReload(t, fsys)
+
+	before := c.scripts()
+	if _, ok := before["getUser"]; !ok {
+		t.Fatal("setup: expected getUser to be resolvable before reload")
+	}
+
+	delete(fsys, "scripts/a.xml")
+
+	if err := c.ReloadScripts(); err == nil {
+		t.Fatal("expected ReloadScripts to reject a reload that drops a previously-resolvable script")
+	}
+
+	after := c.scripts()
+	if _, ok := after["getUser"]; !ok {
+		t.Error("getUser should still be resolvable after a rejected reload")
+	}
+}
+
+func TestReloadScriptsAllowsAddedAndChangedScripts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"scripts/a.xml": {Data: []byte(`<scripts><script name="getUser">SELECT 1</script></scripts>`)},
+	}
+	c := newTestClientForReload(t, fsys)
+
+	fsys["scripts/a.xml"] = &fstest.MapFile{Data: []byte(`<scripts><script name="getUser">SELECT 2</script><script name="getOrder">SELECT 3</script></scripts>`)}
+
+	if err := c.ReloadScripts(); err != nil {
+		t.Fatalf("ReloadScripts failed: %v", err)
+	}
+
+	after := c.scripts()
+	if _, ok := after["getOrder"]; !ok {
+		t.Error("expected getOrder to be resolvable after reload")
+	}
+	if _, ok := after["getUser"]; !ok {
+		t.Error("expected getUser to still be resolvable after reload")
+	}
+}